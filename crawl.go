@@ -0,0 +1,265 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/temoto/robotstxt"
+)
+
+// crawlQueue 是一個無界限、執行緒安全的 FIFO，讓 worker 在抓取頁面時
+// 發現的新連結可以直接送回佇列，而不必受限於固定容量的 jobs channel
+// （worker 本身正是該 channel 的消費者，若用同一個有界 channel 反過來
+// 塞入新任務很容易自我鎖死）。pending 追蹤目前「還沒處理完」的任務數，
+// 歸零時代表整個 crawl 已經跑完，佇列可以關閉。
+type crawlQueue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	items  []job
+	closed bool
+
+	pending int64
+}
+
+func newCrawlQueue() *crawlQueue {
+	q := &crawlQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// addPending 在不直接放入一筆 job 的情況下預先佔用一個名額，用來讓
+// 「正在讀種子清單」這件事本身也算作一筆 pending 工作，避免佇列在
+// 種子還沒讀完時就被誤判為已清空而提早關閉。
+func (q *crawlQueue) addPending(n int64) {
+	q.mu.Lock()
+	q.pending += n
+	q.mu.Unlock()
+}
+
+func (q *crawlQueue) push(j job) {
+	q.mu.Lock()
+	q.pending++
+	q.items = append(q.items, j)
+	q.cond.Signal()
+	q.mu.Unlock()
+}
+
+// done 標記一筆 pending 工作已完成；歸零時關閉佇列，喚醒所有等待中的 pop。
+func (q *crawlQueue) done() {
+	q.mu.Lock()
+	q.pending--
+	if q.pending <= 0 {
+		q.closed = true
+		q.cond.Broadcast()
+	}
+	q.mu.Unlock()
+}
+
+func (q *crawlQueue) pop() (job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.items) == 0 {
+		return job{}, false
+	}
+	j := q.items[0]
+	q.items = q.items[1:]
+	return j, true
+}
+
+// seedCrawlQueue 讀取輸入檔作為深度 0 的種子 URL，推進同一個 indexCounter
+// 以便跟 crawl 過程中動態發現的連結共用連續的 job index。skip 與
+// produceJobs 的用途相同，讓 --state resume 也能跳過已經跑過的種子 URL。
+func seedCrawlQueue(filePath string, queue *crawlQueue, idx *indexCounter, results chan<- result, skip func(int) (stateRecord, bool)) error {
+	queue.addPending(1)
+	defer queue.done()
+
+	jobs := make(chan job, jobQueueSize)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- produceJobs(filePath, jobs, results, idx, skip)
+	}()
+
+	for j := range jobs {
+		j.depth = 0
+		queue.push(j)
+	}
+	return <-errCh
+}
+
+// feedCrawlQueue 把 crawlQueue 的內容搬進固定容量的 jobs channel 給
+// worker pool 消費；佇列關閉且清空後關閉 jobs，讓下游知道任務已全部完成。
+func feedCrawlQueue(queue *crawlQueue, jobs chan<- job) {
+	defer close(jobs)
+	for {
+		j, ok := queue.pop()
+		if !ok {
+			return
+		}
+		jobs <- j
+	}
+}
+
+// crawler 持有 --crawl 模式的設定與執行期狀態：遞迴深度、同網域限制、
+// include/exclude 過濾、robots.txt 快取，以及已造訪連結的去重集合。
+type crawler struct {
+	maxDepth      int
+	sameHost      bool
+	include       *regexp.Regexp
+	exclude       *regexp.Regexp
+	respectRobots bool
+	includeMeta   bool
+
+	fallback   *http.Transport
+	pool       *proxyPool
+	maxRetries int
+
+	renderer *renderer
+	render   renderMode
+
+	queue   *crawlQueue
+	idx     *indexCounter
+	visited sync.Map // url string -> struct{}
+	robots  sync.Map // origin string -> *robotstxt.RobotsData (nil = unavailable)
+}
+
+// process 抓取一個 job 對應的頁面、寫出結果，並在深度允許的情況下把頁面
+// 上的連結過濾、去重後送回 queue，最後標記這筆任務已完成。
+func (c *crawler) process(j job) result {
+	var doc *goquery.Document
+	var finalURL *url.URL
+	var normalizedURL string
+	var fm fetchMeta
+
+	err := doWithProxyRetry(hostOf(j.url), c.fallback, c.pool, c.maxRetries, func(tr *http.Transport) error {
+		var ferr error
+		doc, finalURL, normalizedURL, fm, ferr = resolveDocument(j.url, tr, c.renderer, c.render)
+		return ferr
+	})
+
+	res := result{
+		index:       j.index,
+		url:         normalizedURL,
+		depth:       j.depth,
+		referrer:    j.referrer,
+		statusCode:  fm.statusCode,
+		contentType: fm.contentType,
+		charsetName: fm.charsetName,
+		size:        fm.size,
+		elapsed:     fm.elapsed,
+	}
+	if finalURL != nil {
+		res.finalURL = finalURL.String()
+	}
+	if err != nil {
+		res.err = err
+		c.queue.done()
+		return res
+	}
+
+	title := doc.Find("title").First().Text()
+	if title == "" {
+		res.err = errNoTitle
+	} else {
+		res.title = title
+	}
+	if c.includeMeta {
+		res.meta = extractPageMeta(doc)
+	}
+
+	if j.depth < c.maxDepth {
+		c.enqueueLinks(doc, finalURL, j.depth+1)
+	}
+
+	c.queue.done()
+	return res
+}
+
+// enqueueLinks 擷取頁面上的 a[href]，解析成絕對 URL，套用
+// same-host/include/exclude/robots.txt 規則，並把首次看到的連結送回佇列。
+func (c *crawler) enqueueLinks(doc *goquery.Document, base *url.URL, nextDepth int) {
+	if base == nil {
+		return
+	}
+
+	doc.Find("a[href]").Each(func(_ int, s *goquery.Selection) {
+		href, ok := s.Attr("href")
+		if !ok {
+			return
+		}
+		ref, err := url.Parse(href)
+		if err != nil {
+			return
+		}
+
+		resolved := base.ResolveReference(ref)
+		if resolved.Scheme != "http" && resolved.Scheme != "https" {
+			return
+		}
+		resolved.Fragment = ""
+
+		if c.sameHost && resolved.Host != base.Host {
+			return
+		}
+
+		link := resolved.String()
+		if c.include != nil && !c.include.MatchString(link) {
+			return
+		}
+		if c.exclude != nil && c.exclude.MatchString(link) {
+			return
+		}
+		if c.respectRobots && !c.allowedByRobots(resolved) {
+			return
+		}
+		if _, loaded := c.visited.LoadOrStore(link, struct{}{}); loaded {
+			return
+		}
+
+		c.queue.push(job{index: c.idx.next(), url: link, depth: nextDepth, referrer: base.String()})
+	})
+}
+
+// allowedByRobots 檢查 u 是否被該網站的 robots.txt 允許抓取，結果以
+// origin 為鍵快取起來，避免每個連結都重新下載一次 robots.txt。
+func (c *crawler) allowedByRobots(u *url.URL) bool {
+	origin := u.Scheme + "://" + u.Host
+
+	var data *robotstxt.RobotsData
+	if cached, ok := c.robots.Load(origin); ok {
+		data, _ = cached.(*robotstxt.RobotsData)
+	} else {
+		data = c.fetchRobots(origin)
+		c.robots.Store(origin, data)
+	}
+
+	if data == nil {
+		return true
+	}
+	return data.TestAgent(u.Path, "TitleFinder")
+}
+
+func (c *crawler) fetchRobots(origin string) *robotstxt.RobotsData {
+	transport := c.fallback
+	if transport == nil {
+		transport, _ = buildTransport(nil)
+	}
+	client := &http.Client{Transport: transport}
+
+	resp, err := client.Get(origin + "/robots.txt")
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+
+	data, err := robotstxt.FromResponse(resp)
+	if err != nil {
+		return nil
+	}
+	return data
+}
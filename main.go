@@ -1,124 +1,272 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"golang.org/x/net/html/charset"
 	"golang.org/x/text/encoding/unicode"
 	"golang.org/x/text/transform"
+	"golang.org/x/time/rate"
 )
 
 const maxThreads = 100 // 設置最大線程數
 
+// errNoTitle 代表頁面成功取得但找不到 <title> 元素，getTitle 與 crawl
+// 模式的 process 共用這個值，方便呼叫端用 errors.Is 判斷。
+var errNoTitle = errors.New("no title found")
+
 type result struct {
-	index int
-	url   string
-	title string
-	err   error
+	index    int
+	url      string
+	title    string
+	err      error
+	depth    int
+	referrer string
+
+	statusCode  int
+	finalURL    string
+	contentType string
+	charsetName string
+	size        int64
+	elapsed     time.Duration
+
+	meta *pageMeta
 }
 
-func getTitle(urlStr string, index int, proxyURL *url.URL) result {
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
+// pageMeta 收集 --meta 啟用時額外擷取的 meta 標籤與 canonical 連結。
+// 用指標而非內嵌欄位，這樣沒有要求 meta 資訊的呼叫端可以直接留 nil，
+// text/jsonl/json/csv 輸出就能分辨「沒擷取」跟「擷取到空字串」。
+type pageMeta struct {
+	description string
+	ogTitle     string
+	ogImage     string
+	canonical   string
+}
+
+// extractPageMeta 從已解析的文件擷取 meta description、og:title、
+// og:image 與 canonical link，供 --meta 模式使用。
+func extractPageMeta(doc *goquery.Document) *pageMeta {
+	return &pageMeta{
+		description: doc.Find(`meta[name="description"]`).AttrOr("content", ""),
+		ogTitle:     doc.Find(`meta[property="og:title"]`).AttrOr("content", ""),
+		ogImage:     doc.Find(`meta[property="og:image"]`).AttrOr("content", ""),
+		canonical:   doc.Find(`link[rel="canonical"]`).AttrOr("href", ""),
+	}
+}
+
+// countingReader 包著另一個 io.Reader，統計實際讀到的位元組數，用來在
+// 不緩衝整份回應內容的前提下量出回應大小。
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
 
-	if !strings.HasPrefix(urlStr, "http://") && !strings.HasPrefix(urlStr, "https://") {
-		urlStr = "http://" + urlStr
+// fetchMeta 收集單次請求的 HTTP 層中繼資訊：狀態碼、內容類型、偵測到的
+// 字元編碼、回應大小與耗時。getTitle 與 crawl 模式共用這份資料來組出
+// 結構化輸出（--format jsonl/json/csv）需要的欄位。
+type fetchMeta struct {
+	statusCode  int
+	contentType string
+	charsetName string
+	size        int64
+	elapsed     time.Duration
+}
+
+// fetchDocument 發送請求並回傳解析後的 HTML 文件、重新導向後的最終 URL、
+// 正規化過（補上預設 scheme）的請求 URL，以及這次請求的中繼資訊。
+// getTitle 與 crawl 模式的連結擷取都建立在這個函式之上，避免重複請求/
+// 解碼邏輯。
+func fetchDocument(urlStr string, transport *http.Transport) (doc *goquery.Document, finalURL *url.URL, normalizedURL string, meta fetchMeta, err error) {
+	normalizedURL = urlStr
+	if !strings.HasPrefix(normalizedURL, "http://") && !strings.HasPrefix(normalizedURL, "https://") {
+		normalizedURL = "http://" + normalizedURL
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", normalizedURL, nil)
 	if err != nil {
-		return result{index: index, url: urlStr, err: fmt.Errorf("failed to create request: %w", err)}
+		return nil, nil, normalizedURL, meta, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// 添加自訂請求頭
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/111.0.0.0 YaBrowser/23.3.1.895 Yowser/2.5 Safari/537.36")
 	req.Header.Set("Accept-Language", "ru,en;q=0.9,en-US;q=0.8")
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
 
-	if proxyURL != nil {
-		tr.Proxy = http.ProxyURL(proxyURL)
+	if transport == nil {
+		transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
 	}
 
 	client := &http.Client{
-		Transport: tr,
+		Transport: transport,
 		Timeout:   10 * time.Second,
 	}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return result{index: index, url: urlStr, err: fmt.Errorf("request failed: %w", err)}
+		meta.elapsed = time.Since(start)
+		return nil, nil, normalizedURL, meta, fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
+	meta.statusCode = resp.StatusCode
+	meta.contentType = resp.Header.Get("Content-Type")
+	meta.charsetName = detectCharsetName(meta.contentType)
+
 	if resp.StatusCode != http.StatusOK {
-		return result{index: index, url: urlStr, err: fmt.Errorf("HTTP error: %s", resp.Status)}
+		meta.elapsed = time.Since(start)
+		return nil, resp.Request.URL, normalizedURL, meta, fmt.Errorf("HTTP error: %s", resp.Status)
 	}
 
+	counted := &countingReader{r: resp.Body}
+
 	// 檢測字符編碼
-	bodyReader, err := charset.NewReader(resp.Body, resp.Header.Get("Content-Type"))
+	bodyReader, err := charset.NewReader(counted, meta.contentType)
 	if err != nil {
-		return result{index: index, url: urlStr, err: fmt.Errorf("failed to create reader: %w", err)}
+		meta.elapsed = time.Since(start)
+		return nil, resp.Request.URL, normalizedURL, meta, fmt.Errorf("failed to create reader: %w", err)
 	}
 
 	// 創建一個 UTF-8 reader
 	utfReader := transform.NewReader(bodyReader, unicode.UTF8.NewDecoder())
 
 	// 使用 goquery 解析 HTML
-	doc, err := goquery.NewDocumentFromReader(utfReader)
+	doc, err = goquery.NewDocumentFromReader(utfReader)
+	meta.size = counted.n
+	meta.elapsed = time.Since(start)
 	if err != nil {
-		return result{index: index, url: urlStr, err: fmt.Errorf("failed to parse HTML: %w", err)}
+		return nil, resp.Request.URL, normalizedURL, meta, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	return doc, resp.Request.URL, normalizedURL, meta, nil
+}
+
+// detectCharsetName 從 Content-Type 標頭的 charset 參數讀出聲明的字元
+// 編碼；沒有宣告時回傳 "utf-8"，因為輸出內容最終都會被轉成 UTF-8。
+func detectCharsetName(contentType string) string {
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		if cs, ok := params["charset"]; ok {
+			return strings.ToLower(cs)
+		}
+	}
+	return "utf-8"
+}
+
+func getTitle(urlStr string, index int, transport *http.Transport, includeMeta bool, r *renderer, mode renderMode) result {
+	doc, finalURL, normalizedURL, fm, err := resolveDocument(urlStr, transport, r, mode)
+	res := result{
+		index:       index,
+		url:         normalizedURL,
+		statusCode:  fm.statusCode,
+		contentType: fm.contentType,
+		charsetName: fm.charsetName,
+		size:        fm.size,
+		elapsed:     fm.elapsed,
+	}
+	if finalURL != nil {
+		res.finalURL = finalURL.String()
+	}
+	if err != nil {
+		res.err = err
+		return res
 	}
 
 	title := doc.Find("title").First().Text()
 	if title == "" {
-		return result{index: index, url: urlStr, err: fmt.Errorf("no title found")}
+		res.err = errNoTitle
+	} else {
+		res.title = title
 	}
-
-	return result{index: index, url: urlStr, title: title}
+	if includeMeta {
+		res.meta = extractPageMeta(doc)
+	}
+	return res
 }
 
 func printHelp() {
-	fmt.Println("Usage: TitleFinder.exe -l <file> [-o <output>] [-p <proxy>] [-t <threads>]")
+	fmt.Println("Usage: TitleFinder.exe -l <file> [-o <output>] [-p <proxy>] [-P <proxy-list>] [-t <threads>]")
 	fmt.Println("\nOptions:")
-	fmt.Println("  -l <file>    Path to the input file containing URLs (required)")
-	fmt.Println("  -o <output>  Path to the output file (optional). If not provided, output will be printed to the console.")
-	fmt.Println("  -p <proxy>   Proxy URL to use for HTTP requests (optional). Format: [http://]host:port")
-	fmt.Println("               If protocol is not specified, http:// will be used by default.")
-	fmt.Println("  -t <threads> Number of concurrent threads (optional, default 10)")
-	fmt.Println("  -h           Display this help message")
-}
-
-type job struct {
-	index int
-	url   string
-}
-
-func worker(id int, jobs <-chan job, results chan<- result, proxyURL *url.URL) {
-	_ = id
-	for j := range jobs {
-		results <- getTitle(j.url, j.index, proxyURL)
-	}
+	fmt.Println("  -l <file>        Path to the input file containing URLs (required)")
+	fmt.Println("  -o <output>      Path to the output file (optional). If not provided, output will be printed to the console.")
+	fmt.Println("  -p <proxy>       Proxy URL to use for HTTP requests (optional). Format: [http(s)|socks5|socks5h://]host:port")
+	fmt.Println("                   If protocol is not specified, http:// will be used by default.")
+	fmt.Println("  -P <file>        Path to a file with one proxy URL per line (http, https, socks5, socks5h). Overrides -p.")
+	fmt.Println("  --proxy-mode     How to pick a proxy from -P for each request: rotate (default), random, sticky-host")
+	fmt.Println("  --proxy-retries  How many times to retry a URL through the next healthy proxy on connection failure (default 2)")
+	fmt.Println("  --proxy-cooldown Seconds a failed proxy is skipped before being retried (default 30)")
+	fmt.Println("  -t <threads>     Number of concurrent threads (optional, default 10)")
+	fmt.Println("  --rps <n>        Maximum requests per second across all workers (optional, 0 = unlimited)")
+	fmt.Println("  --host-concurrency <n>  Maximum concurrent requests per target host (optional, default 4, 0 = unlimited)")
+	fmt.Println("  --crawl          Recursively follow links found on each page, up to --depth (optional)")
+	fmt.Println("  --depth <n>      Maximum link-following depth when --crawl is set (default 1)")
+	fmt.Println("  --same-host      When crawling, only follow links on the same host as the page they were found on")
+	fmt.Println("  --include <re>   When crawling, only follow links whose URL matches this regexp")
+	fmt.Println("  --exclude <re>   When crawling, skip links whose URL matches this regexp")
+	fmt.Println("  --respect-robots When crawling, skip links disallowed by the target site's robots.txt")
+	fmt.Println("  --format <fmt>   Output format: text (default), jsonl, json, or csv")
+	fmt.Println("  --meta           Also extract meta description, og:title, og:image, and canonical link")
+	fmt.Println("  --state <file>   Path to an append-only state log; lets a crashed/interrupted run resume (optional, not supported together with --crawl)")
+	fmt.Println("  --state-sync-seconds <n>  How often to fsync the state log, in seconds (default 5)")
+	fmt.Println("  --retry-failed   On resume, re-run entries whose last state record errored or matched --retry-status")
+	fmt.Println("  --retry-status   Status codes/classes counted as failed for --retry-failed, e.g. 5xx,429 (default)")
+	fmt.Println("  --render[=auto]  Render pages with headless Chrome before reading the title (off by default).")
+	fmt.Println("                   Bare --render is equivalent to --render=on; --render=auto only renders when the static title is empty.")
+	fmt.Println("  --render-timeout <n>      Seconds allowed for a single page render (default 20)")
+	fmt.Println("  --render-concurrency <n>  Maximum number of browser tabs open at once (default 4)")
+	fmt.Println("  -h               Display this help message")
 }
 
 func main() {
 	filePath := flag.String("l", "", "Path to the txt file to be loaded")
 	outputPath := flag.String("o", "", "Path to the output file (optional)")
-	proxy := flag.String("p", "", "Proxy URL to use for HTTP requests (optional)")
+	proxyFlag := flag.String("p", "", "Proxy URL to use for HTTP requests (optional)")
+	proxyListPath := flag.String("P", "", "Path to a file with one proxy URL per line (optional)")
+	proxyMode := flag.String("proxy-mode", "rotate", "Proxy selection mode when using -P: rotate, random, sticky-host")
+	proxyRetries := flag.Int("proxy-retries", 2, "Retries through the next healthy proxy on connection failure")
+	proxyCooldown := flag.Int("proxy-cooldown", 30, "Seconds a failed proxy is skipped before being retried")
 	threads := flag.Int("t", 10, "Number of concurrent threads (default 10, max 100)")
+	rps := flag.Int("rps", 0, "Maximum requests per second across all workers (0 = unlimited)")
+	hostConcurrency := flag.Int("host-concurrency", 4, "Maximum concurrent requests per target host (0 = unlimited)")
+	crawlMode := flag.Bool("crawl", false, "Recursively follow links found on each page, up to --depth")
+	crawlDepth := flag.Int("depth", 1, "Maximum link-following depth when --crawl is set")
+	sameHost := flag.Bool("same-host", false, "When crawling, only follow links on the same host as the page they were found on")
+	includePattern := flag.String("include", "", "When crawling, only follow links whose URL matches this regexp")
+	excludePattern := flag.String("exclude", "", "When crawling, skip links whose URL matches this regexp")
+	respectRobots := flag.Bool("respect-robots", false, "When crawling, skip links disallowed by the target site's robots.txt")
+	format := flag.String("format", "text", "Output format: text, jsonl, json, or csv")
+	includeMeta := flag.Bool("meta", false, "Also extract meta description, og:title, og:image, and canonical link")
+	statePath := flag.String("state", "", "Path to an append-only state log for crash-recovery/resume (optional)")
+	stateSyncSeconds := flag.Int("state-sync-seconds", 5, "How often to fsync the state log, in seconds")
+	retryFailed := flag.Bool("retry-failed", false, "On resume, re-run entries whose last state record errored or matched --retry-status")
+	retryStatus := flag.String("retry-status", "5xx,429", "Status codes/classes counted as failed for --retry-failed")
+	mode := renderOff
+	flag.Var(renderModeFlag{mode: &mode}, "render", "Render pages with headless Chrome: on, off (default), or auto (render only when the static title is empty)")
+	renderTimeout := flag.Int("render-timeout", 20, "Seconds allowed for a single page render")
+	renderConcurrency := flag.Int("render-concurrency", 4, "Maximum number of browser tabs open at once")
 	help := flag.Bool("h", false, "Display help message")
 	flag.Parse()
 
@@ -133,82 +281,192 @@ func main() {
 		log.Fatal("Please provide the path to the txt file using -l parameter")
 	}
 
+	// --crawl 下新發現的連結是用 indexCounter 現場配發的遞增號碼，同一個
+	// URL 在不同次執行裡發現的順序不保證一樣，不像種子清單的 index 那樣
+	// 跨次執行穩定；--state 的 resume/skip 邏輯則是以 index 為鍵比對舊
+	// 紀錄。兩者一起用，resume 時重新整理出的 child index 極可能撞上舊
+	// state 檔裡屬於別的 URL 的紀錄，在目前的實作下先直接拒絕這個組合。
+	if *crawlMode && *statePath != "" {
+		log.Fatal("--state does not yet support --crawl: crawl-discovered links don't have a stable index across runs")
+	}
+
 	// 檢查並限制線程數
 	if *threads > maxThreads {
 		log.Printf("[!] Warning: Thread count exceeds maximum allowed (%d). Setting to max.\n", maxThreads)
 		*threads = maxThreads
 	}
 
-	var proxyURL *url.URL
+	var fallbackTransport *http.Transport
+	var pool *proxyPool
 	var err error
-	if *proxy != "" {
+
+	switch {
+	case *proxyListPath != "":
+		switch *proxyMode {
+		case "rotate", "random", "sticky-host":
+		default:
+			log.Fatalf("Invalid --proxy-mode: %s (expected rotate, random, or sticky-host)", *proxyMode)
+		}
+		entries, err := loadProxyFile(*proxyListPath)
+		if err != nil {
+			log.Fatalf("Failed to load proxy list: %s", err)
+		}
+		pool = newProxyPool(entries, *proxyMode, time.Duration(*proxyCooldown)*time.Second)
+		fallbackTransport, err = buildTransport(nil)
+		if err != nil {
+			log.Fatalf("Failed to build fallback transport: %s", err)
+		}
+	case *proxyFlag != "":
 		// 如果用戶沒有指定協議，預設使用 http://
-		if !strings.HasPrefix(*proxy, "http://") && !strings.HasPrefix(*proxy, "https://") {
-			*proxy = "http://" + *proxy
+		if !strings.Contains(*proxyFlag, "://") {
+			*proxyFlag = "http://" + *proxyFlag
 		}
-		proxyURL, err = url.Parse(*proxy)
+		proxyURL, err := url.Parse(*proxyFlag)
 		if err != nil {
 			log.Fatalf("Invalid proxy URL: %s", err)
 		}
+		fallbackTransport, err = buildTransport(proxyURL)
+		if err != nil {
+			log.Fatalf("Invalid proxy URL: %s", err)
+		}
+	default:
+		fallbackTransport, err = buildTransport(nil)
+		if err != nil {
+			log.Fatalf("Failed to build transport: %s", err)
+		}
 	}
 
-	file, err := os.Open(*filePath)
-	if err != nil {
-		log.Fatalf("Failed to open file: %s", err)
+	// resolveDocument 的 render 路徑是開一顆獨立的 headless Chrome 分頁直接
+	// 導覽，完全不經過 -p/-P 設定的 transport（見 render.go resolveDocument
+	// 的說明）。如果使用者兩者都設了，渲染出來的頁面會從本機真實的對外 IP
+	// 連線，而不是 proxy/Tor，這跟設定 proxy 的初衷相反，所以在這裡提醒。
+	if mode != renderOff && (*proxyFlag != "" || *proxyListPath != "") {
+		log.Printf("[!] Warning: --render does not route through -p/-P; rendered pages will be fetched from this machine's real network, not through the configured proxy.")
 	}
-	defer file.Close()
 
-	urls := make([]string, 0)
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		urls = append(urls, scanner.Text())
+	var outputFile io.Writer
+	if *outputPath != "" {
+		output, err := os.Create(*outputPath)
+		if err != nil {
+			log.Fatalf("Failed to create output file: %s", err)
+		}
+		defer output.Close()
+		outputFile = output
+	} else {
+		outputFile = os.Stdout
 	}
 
-	if err := scanner.Err(); err != nil {
-		log.Fatalf("Error reading file: %s", err)
+	writer, err := newResultWriter(*format, outputFile)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	results := make(chan result, len(urls))
-	jobs := make(chan job, len(urls))
-
-	// 啟動 worker
-	for w := 1; w <= *threads; w++ {
-		go worker(w, jobs, results, proxyURL)
+	var limiter *rate.Limiter
+	if *rps > 0 {
+		limiter = rate.NewLimiter(rate.Limit(*rps), *rps)
 	}
+	hosts := newHostLimiter(*hostConcurrency)
+	idx := &indexCounter{}
 
-	// 發送任務
-	for i, url := range urls {
-		jobs <- job{index: i, url: url}
+	var rend *renderer
+	if mode != renderOff {
+		rend = newRenderer(*renderConcurrency, time.Duration(*renderTimeout)*time.Second)
+		defer rend.close()
 	}
-	close(jobs)
 
-	// 收集結果
-	resultMap := make(map[int]result)
-	for i := 0; i < len(urls); i++ {
-		res := <-results
-		resultMap[res.index] = res
+	var c *crawler
+	if *crawlMode {
+		var includeRe, excludeRe *regexp.Regexp
+		if *includePattern != "" {
+			includeRe, err = regexp.Compile(*includePattern)
+			if err != nil {
+				log.Fatalf("Invalid --include regexp: %s", err)
+			}
+		}
+		if *excludePattern != "" {
+			excludeRe, err = regexp.Compile(*excludePattern)
+			if err != nil {
+				log.Fatalf("Invalid --exclude regexp: %s", err)
+			}
+		}
+		c = &crawler{
+			maxDepth:      *crawlDepth,
+			sameHost:      *sameHost,
+			include:       includeRe,
+			exclude:       excludeRe,
+			respectRobots: *respectRobots,
+			includeMeta:   *includeMeta,
+			fallback:      fallbackTransport,
+			pool:          pool,
+			maxRetries:    *proxyRetries,
+			renderer:      rend,
+			render:        mode,
+			queue:         newCrawlQueue(),
+			idx:           idx,
+		}
 	}
 
-	var output *os.File
-	var outputFile io.Writer
+	var skip func(int) (stateRecord, bool)
+	var state *stateWriter
+	if *statePath != "" {
+		completed, err := loadStateFile(*statePath)
+		if err != nil {
+			log.Fatalf("Failed to load state file: %s", err)
+		}
+		isFailedStatus, err := parseRetryStatusSpec(*retryStatus)
+		if err != nil {
+			log.Fatal(err)
+		}
+		skip = resumeSkipper(completed, *retryFailed, isFailedStatus)
 
-	if *outputPath != "" {
-		output, err = os.Create(*outputPath)
+		state, err = newStateWriter(*statePath, time.Duration(*stateSyncSeconds)*time.Second)
 		if err != nil {
-			log.Fatalf("Failed to create output file: %s", err)
+			log.Fatalf("Failed to open state file: %s", err)
 		}
-		defer output.Close()
-		outputFile = output
-	} else {
-		outputFile = os.Stdout
 	}
 
-	for i := 0; i < len(resultMap); i++ {
-		res := resultMap[i]
-		if res.err != nil {
-			fmt.Fprintf(outputFile, "[-] %s: %s\n", res.url, res.err)
+	jobs := make(chan job, jobQueueSize)
+	results := make(chan result, jobQueueSize)
+
+	// 啟動固定大小的 worker pool，每個都從同一個 jobs channel 消費任務，
+	// 並共用 rate limiter 與 per-host 並發限制。
+	var wg sync.WaitGroup
+	for w := 1; w <= *threads; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker(jobs, results, fallbackTransport, pool, *proxyRetries, limiter, hosts, c, *includeMeta, rend, mode)
+		}()
+	}
+
+	// producer 也計入 wg：resume 時它會直接把重播的結果送進 results，
+	// 必須跟 worker 一樣等它跑完才能關閉 results。
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if c != nil {
+			if err := seedCrawlQueue(*filePath, c.queue, idx, results, skip); err != nil {
+				log.Fatalf("Failed to read input file: %s", err)
+			}
 		} else {
-			fmt.Fprintf(outputFile, "[+] %s: %s\n", res.url, res.title)
+			if err := produceJobs(*filePath, jobs, results, idx, skip); err != nil {
+				log.Fatalf("Failed to read input file: %s", err)
+			}
 		}
+	}()
+
+	if c != nil {
+		// crawl 模式下，新發現的連結會動態送回 c.queue，所以改由
+		// feedCrawlQueue 把佇列內容搬進固定容量的 jobs channel。
+		go feedCrawlQueue(c.queue, jobs)
 	}
+
+	// 所有 worker 跟 producer 結束後關閉 results，讓下面的重排輸出迴圈
+	// 知道何時停止。
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	writeOrdered(results, writer, state)
 }
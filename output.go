@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// resultWriter 把依序到達的 result 寫成某種輸出格式。writeOrdered 只知道
+// 結果已經照輸入順序排好，實際的格式（text/jsonl/json/csv）交給實作決定；
+// close 讓需要收尾的格式（例如 json 陣列的結尾括號）有機會完成輸出。
+type resultWriter interface {
+	writeResult(res result)
+	close()
+}
+
+// newResultWriter 依 --format 建立對應的 resultWriter。
+func newResultWriter(format string, out io.Writer) (resultWriter, error) {
+	switch format {
+	case "", "text":
+		return &textWriter{out: out}, nil
+	case "jsonl":
+		return &jsonlWriter{out: out, enc: json.NewEncoder(out)}, nil
+	case "json":
+		return &jsonWriter{out: out}, nil
+	case "csv":
+		return &csvWriter{out: out, w: csv.NewWriter(out)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported --format: %s (expected text, jsonl, json, or csv)", format)
+	}
+}
+
+// resultRecord 是 result 的可序列化形態，供 jsonl/json/csv 輸出共用。
+// meta 相關欄位只有在 --meta 被啟用時才非空，省略的欄位在 JSON 中就會
+// 被略過，在 CSV 中則輸出空字串。
+type resultRecord struct {
+	Index       int    `json:"index"`
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Error       string `json:"error,omitempty"`
+	Depth       int    `json:"depth,omitempty"`
+	Referrer    string `json:"referrer,omitempty"`
+	StatusCode  int    `json:"status_code,omitempty"`
+	FinalURL    string `json:"final_url,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Charset     string `json:"charset,omitempty"`
+	Size        int64  `json:"size_bytes,omitempty"`
+	ElapsedMS   int64  `json:"elapsed_ms"`
+
+	Description string `json:"meta_description,omitempty"`
+	OGTitle     string `json:"meta_og_title,omitempty"`
+	OGImage     string `json:"meta_og_image,omitempty"`
+	Canonical   string `json:"canonical,omitempty"`
+}
+
+// toRecord 把 result 攤平成 resultRecord，供結構化輸出格式使用。
+func (res result) toRecord() resultRecord {
+	rec := resultRecord{
+		Index:       res.index,
+		URL:         res.url,
+		Title:       res.title,
+		Depth:       res.depth,
+		Referrer:    res.referrer,
+		StatusCode:  res.statusCode,
+		FinalURL:    res.finalURL,
+		ContentType: res.contentType,
+		Charset:     res.charsetName,
+		Size:        res.size,
+		ElapsedMS:   res.elapsed.Milliseconds(),
+	}
+	if res.err != nil {
+		rec.Error = res.err.Error()
+	}
+	if res.meta != nil {
+		rec.Description = res.meta.description
+		rec.OGTitle = res.meta.ogTitle
+		rec.OGImage = res.meta.ogImage
+		rec.Canonical = res.meta.canonical
+	}
+	return rec
+}
+
+// textWriter 重現原本的 `[+] url: title` / `[-] url: err` 輸出，crawl
+// 模式下的結果會額外帶上 depth 與 referrer。
+type textWriter struct {
+	out io.Writer
+}
+
+func (w *textWriter) writeResult(res result) {
+	suffix := ""
+	if res.referrer != "" {
+		suffix = fmt.Sprintf(" (depth=%d, from=%s)", res.depth, res.referrer)
+	}
+	if res.err != nil {
+		fmt.Fprintf(w.out, "[-] %s: %s%s\n", res.url, res.err, suffix)
+	} else {
+		fmt.Fprintf(w.out, "[+] %s: %s%s\n", res.url, res.title, suffix)
+	}
+}
+
+func (w *textWriter) close() {}
+
+// jsonlWriter 每筆結果各佔一行 JSON，適合串流消費。
+type jsonlWriter struct {
+	out io.Writer
+	enc *json.Encoder
+}
+
+func (w *jsonlWriter) writeResult(res result) {
+	_ = w.enc.Encode(res.toRecord())
+}
+
+func (w *jsonlWriter) close() {}
+
+// jsonWriter 把所有結果輸出成單一 JSON 陣列，邊收邊寫而不先緩衝整份結果
+// 在記憶體裡，只在第一筆與收尾時補上陣列的標點。
+type jsonWriter struct {
+	out    io.Writer
+	first  bool
+	opened bool
+}
+
+func (w *jsonWriter) writeResult(res result) {
+	if !w.opened {
+		fmt.Fprint(w.out, "[\n")
+		w.opened = true
+		w.first = true
+	}
+	if !w.first {
+		fmt.Fprint(w.out, ",\n")
+	}
+	w.first = false
+	b, err := json.Marshal(res.toRecord())
+	if err != nil {
+		return
+	}
+	w.out.Write(b)
+}
+
+func (w *jsonWriter) close() {
+	if !w.opened {
+		fmt.Fprint(w.out, "[]\n")
+		return
+	}
+	fmt.Fprint(w.out, "\n]\n")
+}
+
+// csvWriter 輸出 resultRecord 欄位，第一筆結果前先寫出表頭。
+type csvWriter struct {
+	out         io.Writer
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+var csvHeader = []string{
+	"index", "url", "title", "error", "depth", "referrer",
+	"status_code", "final_url", "content_type", "charset", "size_bytes", "elapsed_ms",
+	"meta_description", "meta_og_title", "meta_og_image", "canonical",
+}
+
+func (w *csvWriter) writeResult(res result) {
+	if !w.wroteHeader {
+		_ = w.w.Write(csvHeader)
+		w.wroteHeader = true
+	}
+	rec := res.toRecord()
+	_ = w.w.Write([]string{
+		strconv.Itoa(rec.Index), rec.URL, rec.Title, rec.Error,
+		strconv.Itoa(rec.Depth), rec.Referrer,
+		strconv.Itoa(rec.StatusCode), rec.FinalURL, rec.ContentType, rec.Charset,
+		strconv.FormatInt(rec.Size, 10), strconv.FormatInt(rec.ElapsedMS, 10),
+		rec.Description, rec.OGTitle, rec.OGImage, rec.Canonical,
+	})
+	w.w.Flush()
+}
+
+func (w *csvWriter) close() {}
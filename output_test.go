@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestResultToRecord 確認 toRecord 把 result 攤平成 resultRecord 時，
+// 錯誤被轉成字串、耗時被換算成毫秒，meta 欄位在 nil 時保持空白。
+func TestResultToRecord(t *testing.T) {
+	res := result{
+		index:       3,
+		url:         "http://example.com",
+		title:       "Example",
+		depth:       2,
+		referrer:    "http://example.com/start",
+		statusCode:  200,
+		finalURL:    "http://example.com/final",
+		contentType: "text/html; charset=utf-8",
+		charsetName: "utf-8",
+		size:        1234,
+		elapsed:     250 * time.Millisecond,
+	}
+	rec := res.toRecord()
+
+	if rec.Index != 3 || rec.URL != res.url || rec.Title != "Example" {
+		t.Fatalf("unexpected base fields: %+v", rec)
+	}
+	if rec.ElapsedMS != 250 {
+		t.Errorf("ElapsedMS = %d, want 250", rec.ElapsedMS)
+	}
+	if rec.Error != "" {
+		t.Errorf("Error = %q, want empty", rec.Error)
+	}
+	if rec.Description != "" || rec.OGTitle != "" {
+		t.Errorf("expected empty meta fields when res.meta is nil, got %+v", rec)
+	}
+
+	errRes := result{err: errors.New("boom")}
+	if got := errRes.toRecord().Error; got != "boom" {
+		t.Errorf("Error = %q, want %q", got, "boom")
+	}
+
+	withMeta := result{meta: &pageMeta{description: "desc", ogTitle: "og", ogImage: "img", canonical: "can"}}
+	rec = withMeta.toRecord()
+	if rec.Description != "desc" || rec.OGTitle != "og" || rec.OGImage != "img" || rec.Canonical != "can" {
+		t.Errorf("unexpected meta fields: %+v", rec)
+	}
+}
+
+// TestJSONWriterProducesValidArray 確認 jsonWriter 收尾後輸出的是一個
+// 合法的 JSON 陣列，即使沒有任何結果。
+func TestJSONWriterProducesValidArray(t *testing.T) {
+	var buf bytes.Buffer
+	w := &jsonWriter{out: &buf}
+	w.writeResult(result{index: 0, url: "a", title: "A"})
+	w.writeResult(result{index: 1, url: "b", title: "B"})
+	w.close()
+
+	var records []resultRecord
+	if err := json.Unmarshal(buf.Bytes(), &records); err != nil {
+		t.Fatalf("output is not valid JSON: %s\n%s", err, buf.String())
+	}
+	if len(records) != 2 || records[0].URL != "a" || records[1].URL != "b" {
+		t.Errorf("unexpected records: %+v", records)
+	}
+}
+
+// TestJSONWriterEmptyOutput 確認沒有任何結果時，close 輸出空陣列而不是
+// 留下一個沒收尾的開頭括號。
+func TestJSONWriterEmptyOutput(t *testing.T) {
+	var buf bytes.Buffer
+	w := &jsonWriter{out: &buf}
+	w.close()
+
+	if got := strings.TrimSpace(buf.String()); got != "[]" {
+		t.Errorf("got %q, want %q", got, "[]")
+	}
+}
+
+// TestCSVWriterWritesHeaderOnce 確認表頭只在第一筆結果前寫一次，且欄位
+// 順序跟 csvHeader 一致。
+func TestCSVWriterWritesHeaderOnce(t *testing.T) {
+	var buf bytes.Buffer
+	w := &csvWriter{out: &buf, w: csv.NewWriter(&buf)}
+	w.writeResult(result{index: 0, url: "a", title: "A"})
+	w.writeResult(result{index: 1, url: "b", err: errors.New("boom")})
+
+	r := csv.NewReader(strings.NewReader(buf.String()))
+	rows, err := r.ReadAll()
+	if err != nil {
+		t.Fatalf("failed to parse CSV output: %s", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3 (header + 2 results)", len(rows))
+	}
+	if !equalSlices(rows[0], csvHeader) {
+		t.Errorf("header row = %v, want %v", rows[0], csvHeader)
+	}
+	if rows[1][1] != "a" || rows[2][1] != "b" || rows[2][3] != "boom" {
+		t.Errorf("unexpected data rows: %v", rows[1:])
+	}
+}
+
+func equalSlices(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
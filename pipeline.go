@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/time/rate"
+)
+
+// jobQueueSize 是 jobs / results channel 的緩衝大小。保持固定且遠小於
+// 可能的輸入規模，讓 pipeline 的記憶體用量不隨 URL 清單長度成長。
+const jobQueueSize = 1024
+
+type job struct {
+	index    int
+	url      string
+	depth    int
+	referrer string
+}
+
+// indexCounter 配發遞增且連續的 job index。writeOrdered 的重排緩衝區
+// 假設每個 index 從 0 開始恰好出現一次，crawl 模式下動態產生的新任務
+// 也必須從同一個計數器取號，才能跟原始清單的任務共用同一套排序邏輯。
+type indexCounter struct {
+	n atomic.Int64
+}
+
+func (c *indexCounter) next() int {
+	return int(c.n.Add(1) - 1)
+}
+
+// produceJobs 以串流方式逐行讀取輸入檔並送進 jobs，讀完後關閉 channel。
+// 相較於先把整份 URL 清單載進記憶體，這讓百萬等級的輸入檔也能穩定執行。
+// skip 非 nil 時代表正在 resume 一次帶 --state 的執行：已經有紀錄且
+// 不需要重跑的 index 不會變成 job，而是直接把之前的結果重播進 results。
+func produceJobs(filePath string, jobs chan<- job, results chan<- result, idx *indexCounter, skip func(int) (stateRecord, bool)) error {
+	defer close(jobs)
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		i := idx.next()
+		url := scanner.Text()
+		if skip != nil {
+			if rec, ok := skip(i); ok {
+				results <- replayResult(rec, url)
+				continue
+			}
+		}
+		jobs <- job{index: i, url: url}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading file: %w", err)
+	}
+	return nil
+}
+
+// hostLimiter 限制每個目標 host 同時進行中的請求數，避免單一緩慢的網域
+// 把整個 worker pool 的併發額度耗光。limit <= 0 表示不限制。
+type hostLimiter struct {
+	mu    sync.Mutex
+	sems  map[string]chan struct{}
+	limit int
+}
+
+func newHostLimiter(limit int) *hostLimiter {
+	return &hostLimiter{sems: make(map[string]chan struct{}), limit: limit}
+}
+
+func (h *hostLimiter) acquire(host string) {
+	if h.limit <= 0 {
+		return
+	}
+	h.mu.Lock()
+	sem, ok := h.sems[host]
+	if !ok {
+		sem = make(chan struct{}, h.limit)
+		h.sems[host] = sem
+	}
+	h.mu.Unlock()
+	sem <- struct{}{}
+}
+
+func (h *hostLimiter) release(host string) {
+	if h.limit <= 0 {
+		return
+	}
+	h.mu.Lock()
+	sem := h.sems[host]
+	h.mu.Unlock()
+	if sem != nil {
+		<-sem
+	}
+}
+
+// worker 從 jobs 消費任務直到 channel 關閉，送出前先等待共用的 rate
+// limiter 與目標 host 的併發名額。當 c 非 nil 時代表 crawl 模式，改由
+// crawler 負責擷取連結並把新任務送回佇列；否則只單純抓標題。
+func worker(jobs <-chan job, results chan<- result, fallback *http.Transport, pool *proxyPool, maxRetries int, limiter *rate.Limiter, hosts *hostLimiter, c *crawler, includeMeta bool, r *renderer, mode renderMode) {
+	for j := range jobs {
+		if limiter != nil {
+			_ = limiter.Wait(context.Background())
+		}
+
+		host := hostOf(j.url)
+		hosts.acquire(host)
+		var res result
+		if c != nil {
+			res = c.process(j)
+		} else {
+			res = fetchWithProxy(j, fallback, pool, maxRetries, includeMeta, r, mode)
+		}
+		hosts.release(host)
+
+		results <- res
+	}
+}
+
+// orderedItem 是重排緩衝區裡等待依序輸出的一筆結果。
+type orderedItem struct {
+	index  int
+	result result
+}
+
+type orderedHeap []orderedItem
+
+func (h orderedHeap) Len() int           { return len(h) }
+func (h orderedHeap) Less(i, j int) bool { return h[i].index < h[j].index }
+func (h orderedHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *orderedHeap) Push(x any) {
+	*h = append(*h, x.(orderedItem))
+}
+
+func (h *orderedHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// writeOrdered 從 results 收集亂序完成的結果，用一個小的 min-heap 重排
+// 緩衝區把它們還原成輸入順序，一旦下一個預期的 index 到齊就立刻交給 w
+// 寫出，不必等所有任務都完成才開始輸出。state 非 nil 時，每筆寫出的結果
+// 也會同時記進 --state 日誌，讓之後可以從這次進度繼續執行。
+func writeOrdered(results <-chan result, w resultWriter, state *stateWriter) {
+	buf := &orderedHeap{}
+	heap.Init(buf)
+	next := 0
+
+	for res := range results {
+		heap.Push(buf, orderedItem{index: res.index, result: res})
+		for buf.Len() > 0 && (*buf)[0].index == next {
+			item := heap.Pop(buf).(orderedItem)
+			w.writeResult(item.result)
+			if state != nil {
+				state.record(item.result.toStateRecord())
+			}
+			next++
+		}
+	}
+	w.close()
+	if state != nil {
+		state.close()
+	}
+}
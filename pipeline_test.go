@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+)
+
+// TestWriteOrderedReassemblesOutOfOrderResults 確認 writeOrdered 用 orderedHeap
+// 把亂序完成的 result 還原成輸入順序再交給 resultWriter，即使結果是倒著送進來的。
+func TestWriteOrderedReassemblesOutOfOrderResults(t *testing.T) {
+	results := make(chan result, 5)
+	results <- result{index: 2, url: "c"}
+	results <- result{index: 0, url: "a"}
+	results <- result{index: 1, url: "b"}
+	results <- result{index: 4, url: "e"}
+	results <- result{index: 3, url: "d"}
+	close(results)
+
+	w := &fakeWriter{}
+	writeOrdered(results, w, nil)
+
+	want := []string{"a", "b", "c", "d", "e"}
+	if len(w.urls) != len(want) {
+		t.Fatalf("got %d results, want %d", len(w.urls), len(want))
+	}
+	for i, url := range want {
+		if w.urls[i] != url {
+			t.Errorf("position %d: got %q, want %q", i, w.urls[i], url)
+		}
+	}
+	if !w.closed {
+		t.Error("expected writer to be closed")
+	}
+}
+
+// TestWriteOrderedWaitsForMissingIndex 確認還沒收到的 index 不會讓後面已經
+// 到齊的結果提早被寫出，heap 必須等缺口補上才繼續往下。
+func TestWriteOrderedWaitsForMissingIndex(t *testing.T) {
+	results := make(chan result, 3)
+	results <- result{index: 1, url: "b"}
+	results <- result{index: 2, url: "c"}
+	close(results)
+
+	w := &fakeWriter{}
+	writeOrdered(results, w, nil)
+
+	if len(w.urls) != 0 {
+		t.Fatalf("expected no output while index 0 is missing, got %v", w.urls)
+	}
+}
+
+type fakeWriter struct {
+	urls   []string
+	closed bool
+}
+
+func (w *fakeWriter) writeResult(res result) {
+	w.urls = append(w.urls, res.url)
+}
+
+func (w *fakeWriter) close() {
+	w.closed = true
+}
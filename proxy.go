@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// proxyEntry 代表代理清單中的一筆代理設定，並追蹤它最近是否健康。
+type proxyEntry struct {
+	raw       string
+	url       *url.URL
+	transport *http.Transport
+
+	mu             sync.Mutex
+	unhealthyUntil time.Time
+}
+
+func (e *proxyEntry) healthy() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return time.Now().After(e.unhealthyUntil)
+}
+
+func (e *proxyEntry) markUnhealthy(cooldown time.Duration) {
+	e.mu.Lock()
+	e.unhealthyUntil = time.Now().Add(cooldown)
+	e.mu.Unlock()
+}
+
+// proxyPool 管理一組代理並依照 proxy-mode 選出下一個要使用的代理。
+type proxyPool struct {
+	entries  []*proxyEntry
+	mode     string // "rotate", "random", "sticky-host"
+	cooldown time.Duration
+
+	mu        sync.Mutex
+	next      int
+	stickyMap map[string]*proxyEntry
+}
+
+func newProxyPool(entries []*proxyEntry, mode string, cooldown time.Duration) *proxyPool {
+	return &proxyPool{
+		entries:   entries,
+		mode:      mode,
+		cooldown:  cooldown,
+		stickyMap: make(map[string]*proxyEntry),
+	}
+}
+
+// pick 回傳下一個健康的代理；若所有代理都在冷卻中則回傳 nil。
+func (p *proxyPool) pick(host string) *proxyEntry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.entries) == 0 {
+		return nil
+	}
+
+	switch p.mode {
+	case "random":
+		start := rand.Intn(len(p.entries))
+		for i := 0; i < len(p.entries); i++ {
+			e := p.entries[(start+i)%len(p.entries)]
+			if e.healthy() {
+				return e
+			}
+		}
+	case "sticky-host":
+		if e, ok := p.stickyMap[host]; ok && e.healthy() {
+			return e
+		}
+		for i := 0; i < len(p.entries); i++ {
+			e := p.entries[(p.next+i)%len(p.entries)]
+			if e.healthy() {
+				p.stickyMap[host] = e
+				p.next = (p.next + i + 1) % len(p.entries)
+				return e
+			}
+		}
+	default: // "rotate"
+		for i := 0; i < len(p.entries); i++ {
+			e := p.entries[(p.next+i)%len(p.entries)]
+			if e.healthy() {
+				p.next = (p.next + i + 1) % len(p.entries)
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+// loadProxyFile 讀取 -P 指定的代理清單檔案，每行一個 proxy URL，
+// 支援 http://、https://、socks5:// 及 socks5h://。以 # 開頭的行會被忽略。
+func loadProxyFile(path string) ([]*proxyEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open proxy file: %w", err)
+	}
+	defer f.Close()
+
+	var entries []*proxyEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		u, err := url.Parse(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL %q: %w", line, err)
+		}
+
+		tr, err := buildTransport(u)
+		if err != nil {
+			return nil, fmt.Errorf("proxy %q: %w", line, err)
+		}
+
+		entries = append(entries, &proxyEntry{raw: line, url: u, transport: tr})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading proxy file: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("proxy file %q contains no usable proxies", path)
+	}
+	return entries, nil
+}
+
+// buildTransport 依 proxyURL 的 scheme 建立對應的 http.Transport。
+// socks5:// 會在本機解析 DNS 後再撥號，socks5:// 與 http(s):// 走標準路徑；
+// socks5h:// 則把主機名稱直接交給代理端解析，讓 DNS 查詢發生在代理那一側。
+//
+// 兩種 scheme 都把 DialContext 包成 proxyDialError：http(s) 轉發代理下，
+// net/http 的 DialContext 撥的是代理本身的位址（CONNECT/轉發都是後續步驟），
+// 所以這裡能精準分辨「代理連不上」跟「目標網站慢/連不上」；socks5 則是
+// proxy 套件把連代理與請求代理轉發目標合在同一次 Dial 裡完成，沒辦法切得
+// 這麼細，但仍然比把整個請求的任何錯誤都當成代理故障要準確。
+func buildTransport(proxyURL *url.URL) (*http.Transport, error) {
+	tr := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+
+	if proxyURL == nil {
+		return tr, nil
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https":
+		tr.Proxy = http.ProxyURL(proxyURL)
+		tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, &proxyDialError{err: err}
+			}
+			return conn, nil
+		}
+	case "socks5", "socks5h":
+		dialer, err := proxy.FromURL(proxyURL, proxy.Direct)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create socks5 dialer: %w", err)
+		}
+		remoteDNS := proxyURL.Scheme == "socks5h"
+		tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if !remoteDNS {
+				host, port, err := net.SplitHostPort(addr)
+				if err == nil {
+					if ips, err := net.DefaultResolver.LookupHost(ctx, host); err == nil && len(ips) > 0 {
+						addr = net.JoinHostPort(ips[0], port)
+					}
+				}
+			}
+			var conn net.Conn
+			var err error
+			if d, ok := dialer.(proxy.ContextDialer); ok {
+				conn, err = d.DialContext(ctx, network, addr)
+			} else {
+				conn, err = dialer.Dial(network, addr)
+			}
+			if err != nil {
+				return nil, &proxyDialError{err: err}
+			}
+			return conn, nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme: %s", proxyURL.Scheme)
+	}
+
+	return tr, nil
+}
+
+// proxyDialError 包住建立連線階段（撥號/代理交握）本身失敗的錯誤，
+// 讓 isRetryableProxyErr 能把它跟請求已經送出後才發生的逾時或錯誤
+// （多半是目標網站慢或掛掉，而不是代理本身的問題）區分開來。
+type proxyDialError struct {
+	err error
+}
+
+func (e *proxyDialError) Error() string { return e.err.Error() }
+func (e *proxyDialError) Unwrap() error { return e.err }
+
+// isRetryableProxyErr 判斷這次失敗是否為連線層級的錯誤（值得換一個代理重試），
+// 而不是對方伺服器回應的 HTTP 狀態碼、內容解析錯誤，或單純目標網站太慢/
+// 連不上。只有 DialContext 自己回報的 proxyDialError 才算數——請求已經
+// 撥通之後才發生的逾時（例如 fetchDocument 的 10s/15s client 逾時撞上一個
+// 又慢又掛掉的目標網站）不應該被當成代理不健康，否則清單裡隨便幾個爛網址
+// 就能把整個代理池都敲進冷卻。
+func isRetryableProxyErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	var dialErr *proxyDialError
+	return errors.As(err, &dialErr)
+}
+
+// hostOf 粗略解析出 urlStr 的 host，供 sticky-host 模式分流使用。
+func hostOf(urlStr string) string {
+	if !strings.HasPrefix(urlStr, "http://") && !strings.HasPrefix(urlStr, "https://") {
+		urlStr = "http://" + urlStr
+	}
+	if u, err := url.Parse(urlStr); err == nil {
+		return u.Host
+	}
+	return urlStr
+}
+
+// errAllProxiesUnhealthy 代表 -P 清單裡所有代理目前都在冷卻中，沒有
+// 任何一個可用。doWithProxyRetry 在這種情況下必須直接回報錯誤，絕對不能
+// 退回 fallback transport——那等於繞過使用者明確設定的代理，直接用這台
+// 機器的真實網路連線出去，違背了設定代理的初衷（匿名/路由）。
+var errAllProxiesUnhealthy = errors.New("all proxies unhealthy")
+
+// doWithProxyRetry 依序嘗試 pool 裡健康的代理執行 fn；一旦 fn 回報連線層級
+// 的錯誤，就把該代理標記為不健康並換下一個，最多重試 maxRetries 次。
+// pool 為 nil 時（使用者沒有用 -P）才會用 fallback transport 跑一次；一旦
+// pool 非 nil 卻找不到健康的代理，回傳 errAllProxiesUnhealthy 而不是
+// 靜靜地改用 fallback。
+func doWithProxyRetry(host string, fallback *http.Transport, pool *proxyPool, maxRetries int, fn func(*http.Transport) error) error {
+	if pool == nil {
+		return fn(fallback)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		entry := pool.pick(host)
+		if entry == nil {
+			if lastErr != nil {
+				return lastErr
+			}
+			return errAllProxiesUnhealthy
+		}
+		lastErr = fn(entry.transport)
+		if !isRetryableProxyErr(lastErr) {
+			return lastErr
+		}
+		entry.markUnhealthy(pool.cooldown)
+	}
+	return lastErr
+}
+
+// fetchWithProxy 透過 pool 選擇代理送出請求；連線失敗時把該代理標記為
+// 不健康並換下一個，最多重試 maxRetries 次。pool 為 nil 時退回 fallback
+// transport；pool 非 nil 但所有代理都不健康時回報 errAllProxiesUnhealthy，
+// 不會退回 fallback——這種情況下 fn 完全沒被呼叫過，res 會停在下面預先
+// 填好的 index/url 上，一定要把 doWithProxyRetry 的錯誤補進 res.err，
+// 否則 writeOrdered 會收到一筆 index 不對的零值結果，讓重排用的 min-heap
+// 卡住或覆蓋別筆結果。r 非 nil 時依 mode 決定是否改用 renderer 渲染頁面；
+// 渲染本身不經過 proxy transport，所以重試迴圈裡仍把 transport 傳給
+// getTitle，只有在 mode 為 off 時才真的用得到。
+func fetchWithProxy(j job, fallback *http.Transport, pool *proxyPool, maxRetries int, includeMeta bool, r *renderer, mode renderMode) result {
+	res := result{index: j.index, url: j.url}
+	err := doWithProxyRetry(hostOf(j.url), fallback, pool, maxRetries, func(tr *http.Transport) error {
+		res = getTitle(j.url, j.index, tr, includeMeta, r, mode)
+		return res.err
+	})
+	if err != nil && res.err == nil {
+		res.err = err
+	}
+	res.depth = j.depth
+	res.referrer = j.referrer
+	return res
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newTestEntries(n int) []*proxyEntry {
+	entries := make([]*proxyEntry, n)
+	for i := range entries {
+		entries[i] = &proxyEntry{raw: string(rune('a' + i)), transport: &http.Transport{}}
+	}
+	return entries
+}
+
+// TestProxyPoolRotateSkipsUnhealthy 確認 rotate 模式依序輪替，且會跳過
+// 目前在冷卻中的代理。
+func TestProxyPoolRotateSkipsUnhealthy(t *testing.T) {
+	entries := newTestEntries(3)
+	pool := newProxyPool(entries, "rotate", time.Minute)
+
+	if got := pool.pick("example.com"); got != entries[0] {
+		t.Fatalf("1st pick: got %v, want entries[0]", got)
+	}
+	if got := pool.pick("example.com"); got != entries[1] {
+		t.Fatalf("2nd pick: got %v, want entries[1]", got)
+	}
+
+	entries[2].markUnhealthy(time.Minute)
+	if got := pool.pick("example.com"); got != entries[0] {
+		t.Fatalf("3rd pick should skip unhealthy entries[2]: got %v, want entries[0]", got)
+	}
+}
+
+// TestProxyPoolAllUnhealthyReturnsNil 確認所有代理都在冷卻中時 pick 回傳 nil，
+// 讓呼叫端（doWithProxyRetry）知道沒有健康代理可用。
+func TestProxyPoolAllUnhealthyReturnsNil(t *testing.T) {
+	entries := newTestEntries(2)
+	pool := newProxyPool(entries, "rotate", time.Minute)
+	for _, e := range entries {
+		e.markUnhealthy(time.Minute)
+	}
+	if got := pool.pick("example.com"); got != nil {
+		t.Fatalf("expected nil when all entries unhealthy, got %v", got)
+	}
+}
+
+// TestProxyPoolStickyHostReusesSameEntry 確認 sticky-host 模式對同一個 host
+// 重複回傳同一個代理，直到它被標記不健康。
+func TestProxyPoolStickyHostReusesSameEntry(t *testing.T) {
+	entries := newTestEntries(3)
+	pool := newProxyPool(entries, "sticky-host", time.Minute)
+
+	first := pool.pick("example.com")
+	if first == nil {
+		t.Fatal("expected a healthy entry")
+	}
+	for i := 0; i < 5; i++ {
+		if got := pool.pick("example.com"); got != first {
+			t.Fatalf("sticky-host pick %d: got %v, want %v", i, got, first)
+		}
+	}
+
+	// 另一個 host 不受 sticky 綁定影響，仍然能拿到代理。
+	if got := pool.pick("other.com"); got == nil {
+		t.Fatal("expected a healthy entry for a different host")
+	}
+
+	first.markUnhealthy(time.Minute)
+	if got := pool.pick("example.com"); got == first {
+		t.Fatal("expected sticky-host to move off an unhealthy entry")
+	}
+}
+
+// TestProxyEntryHealthyAfterCooldown 確認冷卻時間一過，代理會重新變健康。
+func TestProxyEntryHealthyAfterCooldown(t *testing.T) {
+	e := &proxyEntry{raw: "a"}
+	e.markUnhealthy(10 * time.Millisecond)
+	if e.healthy() {
+		t.Fatal("expected entry to be unhealthy immediately after marking")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if !e.healthy() {
+		t.Fatal("expected entry to recover after cooldown elapses")
+	}
+}
+
+// TestDoWithProxyRetryAllUnhealthyDoesNotUseFallback 確認 -P 清單裡所有代理
+// 都在冷卻中時，doWithProxyRetry 回報 errAllProxiesUnhealthy 並且絕對不會
+// 呼叫 fn(fallback)——fallback 是未經代理的直接連線，一旦用上就等於讓使用者
+// 明確設定的代理形同虛設，悄悄用這台機器的真實網路出去。
+func TestDoWithProxyRetryAllUnhealthyDoesNotUseFallback(t *testing.T) {
+	entries := newTestEntries(2)
+	pool := newProxyPool(entries, "rotate", time.Minute)
+	for _, e := range entries {
+		e.markUnhealthy(time.Minute)
+	}
+
+	fallback := &http.Transport{}
+	usedFallback := false
+	err := doWithProxyRetry("example.com", fallback, pool, 2, func(tr *http.Transport) error {
+		if tr == fallback {
+			usedFallback = true
+		}
+		return nil
+	})
+
+	if usedFallback {
+		t.Fatal("doWithProxyRetry must never fall back to the direct transport when a pool was configured")
+	}
+	if !errors.Is(err, errAllProxiesUnhealthy) {
+		t.Fatalf("err = %v, want errAllProxiesUnhealthy", err)
+	}
+}
+
+// TestDoWithProxyRetryFallsBackOnlyWithoutPool 確認 fallback transport 只在
+// 使用者根本沒有設定 -P（pool 為 nil）時才會被用到。
+func TestDoWithProxyRetryFallsBackOnlyWithoutPool(t *testing.T) {
+	fallback := &http.Transport{}
+	var got *http.Transport
+	err := doWithProxyRetry("example.com", fallback, nil, 2, func(tr *http.Transport) error {
+		got = tr
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got != fallback {
+		t.Fatalf("expected fallback transport to be used when pool is nil, got %v", got)
+	}
+}
+
+// TestFetchWithProxyAllUnhealthyReportsJobError 確認所有代理都不健康時，
+// fetchWithProxy 回傳的 result 帶有正確的 job index/url 跟
+// errAllProxiesUnhealthy，而不是 fn 從未被呼叫、沒人填過的零值 result——
+// 零值 result 的 index 會跟某個真正的 job（通常是 index 0）衝突，讓
+// writeOrdered 的重排 heap 收到一筆假結果而卡住或覆蓋掉正確的結果。
+func TestFetchWithProxyAllUnhealthyReportsJobError(t *testing.T) {
+	entries := newTestEntries(2)
+	pool := newProxyPool(entries, "rotate", time.Minute)
+	for _, e := range entries {
+		e.markUnhealthy(time.Minute)
+	}
+
+	j := job{index: 7, url: "http://example.com", depth: 1, referrer: "http://ref.example"}
+	res := fetchWithProxy(j, &http.Transport{}, pool, 2, false, nil, renderOff)
+
+	if res.index != 7 {
+		t.Fatalf("index = %d, want 7 (must match the job, not the zero value)", res.index)
+	}
+	if res.url != j.url {
+		t.Fatalf("url = %q, want %q", res.url, j.url)
+	}
+	if !errors.Is(res.err, errAllProxiesUnhealthy) {
+		t.Fatalf("err = %v, want errAllProxiesUnhealthy", res.err)
+	}
+	if res.depth != j.depth || res.referrer != j.referrer {
+		t.Fatalf("depth/referrer not propagated: got depth=%d referrer=%q", res.depth, res.referrer)
+	}
+}
+
+// TestDoWithProxyRetryRetriesThenExhausts 確認連線層級錯誤會換下一個代理
+// 重試，並在重試次數用盡、最後一個代理仍不健康時回報最後一次的錯誤而不是
+// errAllProxiesUnhealthy（還有錯誤可以回報時，那個錯誤比泛用訊息更有用）。
+func TestDoWithProxyRetryRetriesThenExhausts(t *testing.T) {
+	entries := newTestEntries(2)
+	pool := newProxyPool(entries, "rotate", time.Minute)
+
+	dialErr := &proxyDialError{err: errors.New("connection refused")}
+	calls := 0
+	err := doWithProxyRetry("example.com", &http.Transport{}, pool, 1, func(tr *http.Transport) error {
+		calls++
+		return dialErr
+	})
+
+	if calls != 2 {
+		t.Fatalf("expected 2 attempts (maxRetries=1), got %d", calls)
+	}
+	if !errors.Is(err, dialErr) {
+		t.Fatalf("err = %v, want the last dial error", err)
+	}
+}
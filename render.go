@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/chromedp/chromedp"
+)
+
+// renderMode 決定一個請求要不要透過 headless Chrome 渲染：off 完全不用，
+// on 一律渲染，auto 先用一般的 net/http 抓取，只有在抓到的標題是空的
+// 時候才退回渲染（例如標題由前端 JS 填入的頁面）。
+type renderMode string
+
+const (
+	renderOff  renderMode = "off"
+	renderOn   renderMode = "on"
+	renderAuto renderMode = "auto"
+)
+
+// renderModeFlag 讓 --render 同時支援單純當作布林旗標使用（等同 --render=on）
+// 以及帶值使用（--render=auto、--render=off），跟 flag 套件裡其他布林旗標
+// 的使用習慣一致。
+type renderModeFlag struct {
+	mode *renderMode
+}
+
+func (f renderModeFlag) String() string {
+	if f.mode == nil {
+		return string(renderOff)
+	}
+	return string(*f.mode)
+}
+
+func (f renderModeFlag) Set(s string) error {
+	switch s {
+	case "", "true", "on":
+		*f.mode = renderOn
+	case "false", "off":
+		*f.mode = renderOff
+	case "auto":
+		*f.mode = renderAuto
+	default:
+		return fmt.Errorf("invalid --render value %q (expected on, off, or auto)", s)
+	}
+	return nil
+}
+
+func (f renderModeFlag) IsBoolFlag() bool { return true }
+
+// renderer 持有一顆所有渲染請求共用的 headless Chrome 實例。tab 數量由
+// sem 獨立控制，不受 HTTP worker 併發數影響，避免 --render 與 -t 互相
+// 干擾彼此的資源用量。
+type renderer struct {
+	allocCtx context.Context
+	cancel   context.CancelFunc
+	sem      chan struct{}
+	timeout  time.Duration
+}
+
+// newRenderer 啟動共用的 headless Chrome 實例；maxTabs 限制同時開啟的
+// 分頁數，timeout 是單一頁面渲染允許的最長時間。
+func newRenderer(maxTabs int, timeout time.Duration) *renderer {
+	opts := append(chromedp.DefaultExecAllocatorOptions[:],
+		chromedp.Flag("headless", "new"),
+		chromedp.Flag("disable-gpu", true),
+	)
+	allocCtx, cancel := chromedp.NewExecAllocator(context.Background(), opts...)
+	return &renderer{allocCtx: allocCtx, cancel: cancel, sem: make(chan struct{}, maxTabs), timeout: timeout}
+}
+
+// close 關閉共用的 Chrome 實例，釋放它持有的所有分頁與子行程。
+func (r *renderer) close() {
+	r.cancel()
+}
+
+// fetch 開一個新分頁導覽到 urlStr，等待頁面載入完成後讀出渲染後的
+// document.documentElement.outerHTML，再交給 goquery 解析，讓標題與
+// meta 標籤擷取邏輯能跟 net/http 那條路徑共用。
+func (r *renderer) fetch(urlStr string) (doc *goquery.Document, finalURL *url.URL, normalizedURL string, meta fetchMeta, err error) {
+	normalizedURL = urlStr
+	if !strings.HasPrefix(normalizedURL, "http://") && !strings.HasPrefix(normalizedURL, "https://") {
+		normalizedURL = "http://" + normalizedURL
+	}
+
+	r.sem <- struct{}{}
+	defer func() { <-r.sem }()
+
+	start := time.Now()
+
+	tabCtx, tabCancel := chromedp.NewContext(r.allocCtx)
+	defer tabCancel()
+	tabCtx, timeoutCancel := context.WithTimeout(tabCtx, r.timeout)
+	defer timeoutCancel()
+
+	var html, finalLoc string
+	err = chromedp.Run(tabCtx,
+		chromedp.Navigate(normalizedURL),
+		chromedp.ActionFunc(func(ctx context.Context) error { return waitForPageReady(ctx) }),
+		chromedp.Location(&finalLoc),
+		chromedp.OuterHTML("html", &html, chromedp.ByQuery),
+	)
+	meta.elapsed = time.Since(start)
+	if err != nil {
+		return nil, nil, normalizedURL, meta, fmt.Errorf("render failed: %w", err)
+	}
+
+	doc, err = goquery.NewDocumentFromReader(strings.NewReader(html))
+	meta.size = int64(len(html))
+	if err != nil {
+		return nil, nil, normalizedURL, meta, fmt.Errorf("failed to parse rendered HTML: %w", err)
+	}
+
+	if u, uerr := url.Parse(finalLoc); uerr == nil {
+		finalURL = u
+	}
+	return doc, finalURL, normalizedURL, meta, nil
+}
+
+// renderReadyTimeout/renderIdleWait 控制 waitForPageReady 的輪詢上限與
+// 判定「網路閒置」用的粗略等待時間：document.readyState 不提供可靠的
+// network-idle 訊號，所以用一小段固定延遲近似它。
+const (
+	renderReadyTimeout = 10 * time.Second
+	renderReadyPoll    = 100 * time.Millisecond
+	renderIdleWait     = 500 * time.Millisecond
+)
+
+// waitForPageReady 輪詢 document.readyState 直到 complete 或逾時，接著
+// 再多等 renderIdleWait 讓頁面載入後觸發的非同步請求（常見的 JS 填入
+// 標題情境）有機會完成。
+func waitForPageReady(ctx context.Context) error {
+	deadline := time.Now().Add(renderReadyTimeout)
+	for {
+		var ready string
+		if err := chromedp.Evaluate(`document.readyState`, &ready).Do(ctx); err != nil {
+			return err
+		}
+		if ready == "complete" || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(renderReadyPoll)
+	}
+	time.Sleep(renderIdleWait)
+	return nil
+}
+
+// resolveDocument 依 mode 決定要不要透過 renderer 渲染頁面：off 就只走
+// fetchDocument；on 一律用 renderer；auto 先用 fetchDocument，只有在
+// 抓到的 <title> 是空的時候才用 renderer 重試一次。
+func resolveDocument(urlStr string, transport *http.Transport, r *renderer, mode renderMode) (*goquery.Document, *url.URL, string, fetchMeta, error) {
+	if mode == renderOn {
+		return r.fetch(urlStr)
+	}
+
+	doc, finalURL, normalizedURL, meta, err := fetchDocument(urlStr, transport)
+	if mode == renderAuto && err == nil && doc.Find("title").First().Text() == "" {
+		if rDoc, rFinalURL, rNormalizedURL, rMeta, rErr := r.fetch(urlStr); rErr == nil {
+			return rDoc, rFinalURL, rNormalizedURL, rMeta, nil
+		}
+	}
+	return doc, finalURL, normalizedURL, meta, err
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stateRecord 是 --state 日誌裡的一筆紀錄，代表某個 index 對應的 URL
+// 已經跑完（不論成功或失敗）。日誌是 append-only 的 JSON Lines，同一個
+// index 可能因為 --retry-failed 重跑而出現多次，載入時以最後一筆為準。
+type stateRecord struct {
+	Index     int    `json:"index"`
+	URL       string `json:"url"`
+	Status    int    `json:"status,omitempty"`
+	Title     string `json:"title,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// toStateRecord 把 result 濃縮成要寫進 --state 日誌的欄位。
+func (res result) toStateRecord() stateRecord {
+	rec := stateRecord{
+		Index:     res.index,
+		URL:       res.url,
+		Status:    res.statusCode,
+		Title:     res.title,
+		Timestamp: time.Now().Unix(),
+	}
+	if res.err != nil {
+		rec.Error = res.err.Error()
+	}
+	return rec
+}
+
+// replayResult 把一筆舊的 stateRecord 還原成 result，讓 resume 時被跳過
+// 的 URL 仍然能照輸入順序出現在輸出裡，而不必重新抓取。
+func replayResult(rec stateRecord, fallbackURL string) result {
+	res := result{index: rec.Index, url: rec.URL, title: rec.Title, statusCode: rec.Status}
+	if res.url == "" {
+		res.url = fallbackURL
+	}
+	if rec.Error != "" {
+		res.err = errors.New(rec.Error)
+	}
+	return res
+}
+
+// loadStateFile 讀取既有的 --state 日誌，回傳每個 index 最後一筆紀錄。
+// 檔案不存在時視為全新的一次執行，回傳 nil map 且不算錯誤。
+func loadStateFile(path string) (map[int]stateRecord, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state file: %w", err)
+	}
+	defer f.Close()
+
+	completed := make(map[int]stateRecord)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var rec stateRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			continue
+		}
+		completed[rec.Index] = rec
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading state file: %w", err)
+	}
+	return completed, nil
+}
+
+// parseRetryStatusSpec 解析 --retry-status（例如 "5xx,429"）成一個判斷函式，
+// 回報某個狀態碼是否該被視為「失敗」以便 --retry-failed 重跑。
+func parseRetryStatusSpec(spec string) (func(code int) bool, error) {
+	var exact = map[int]bool{}
+	var classes []int
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if len(part) == 3 && strings.HasSuffix(part, "xx") && part[0] >= '1' && part[0] <= '9' {
+			classes = append(classes, int(part[0]-'0'))
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --retry-status entry %q: %w", part, err)
+		}
+		exact[n] = true
+	}
+
+	return func(code int) bool {
+		if exact[code] {
+			return true
+		}
+		for _, c := range classes {
+			if code/100 == c {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// resumeSkipper 依照既有的 --state 紀錄與 --retry-failed 設定，判斷一個
+// job index 在這次執行要不要被跳過（並附上可以直接重播的舊結果）。
+// completed 為 nil 時（沒有 --state 或狀態檔不存在）回傳 nil，讓呼叫端
+// 略過整套 resume 邏輯。
+func resumeSkipper(completed map[int]stateRecord, retryFailed bool, isFailedStatus func(int) bool) func(int) (stateRecord, bool) {
+	if completed == nil {
+		return nil
+	}
+	return func(index int) (stateRecord, bool) {
+		rec, ok := completed[index]
+		if !ok {
+			return stateRecord{}, false
+		}
+		if retryFailed && (rec.Error != "" || isFailedStatus(rec.Status)) {
+			return stateRecord{}, false
+		}
+		return rec, true
+	}
+}
+
+// stateWriter 把完成的結果以 append-only JSON Lines 寫進 --state 檔案，
+// 由專門的 goroutine 透過 records channel 序列化寫入並定期 fsync，
+// 讓主流程不必在每筆結果上等待磁碟 I/O。
+type stateWriter struct {
+	records chan stateRecord
+	done    chan struct{}
+}
+
+func newStateWriter(path string, syncInterval time.Duration) (*stateWriter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state file: %w", err)
+	}
+
+	sw := &stateWriter{records: make(chan stateRecord, 256), done: make(chan struct{})}
+	go sw.run(f, syncInterval)
+	return sw, nil
+}
+
+func (s *stateWriter) run(f *os.File, syncInterval time.Duration) {
+	defer close(s.done)
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+
+	dirty := false
+	for {
+		select {
+		case rec, ok := <-s.records:
+			if !ok {
+				if dirty {
+					_ = f.Sync()
+				}
+				return
+			}
+			_ = enc.Encode(rec)
+			dirty = true
+		case <-ticker.C:
+			if dirty {
+				_ = f.Sync()
+				dirty = false
+			}
+		}
+	}
+}
+
+// record 排入一筆已完成的結果，由 stateWriter 的 goroutine 非同步寫入。
+func (s *stateWriter) record(rec stateRecord) {
+	s.records <- rec
+}
+
+// close 關閉 records channel 並等待寫入 goroutine把剩餘紀錄落盤。
+func (s *stateWriter) close() {
+	close(s.records)
+	<-s.done
+}
@@ -0,0 +1,80 @@
+package main
+
+import "testing"
+
+// TestParseRetryStatusSpec 涵蓋 --retry-status 支援的寫法：精確代碼、
+// xx 代碼類別，以及兩者混用。
+func TestParseRetryStatusSpec(t *testing.T) {
+	isFailed, err := parseRetryStatusSpec("5xx,429")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	cases := []struct {
+		code int
+		want bool
+	}{
+		{500, true},
+		{503, true},
+		{599, true},
+		{429, true},
+		{404, false},
+		{200, false},
+		{400, false},
+	}
+	for _, c := range cases {
+		if got := isFailed(c.code); got != c.want {
+			t.Errorf("isFailed(%d) = %v, want %v", c.code, got, c.want)
+		}
+	}
+}
+
+// TestParseRetryStatusSpecInvalid 確認非數字、非 NxxN 樣式的項目回報錯誤。
+func TestParseRetryStatusSpecInvalid(t *testing.T) {
+	if _, err := parseRetryStatusSpec("not-a-status"); err == nil {
+		t.Fatal("expected an error for an invalid --retry-status entry")
+	}
+}
+
+// TestParseRetryStatusSpecEmptyEntriesIgnored 確認空白項目（例如結尾逗號）
+// 被忽略而不是報錯。
+func TestParseRetryStatusSpecEmptyEntriesIgnored(t *testing.T) {
+	isFailed, err := parseRetryStatusSpec("5xx,")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !isFailed(500) {
+		t.Error("expected 500 to be treated as failed")
+	}
+	if isFailed(200) {
+		t.Error("expected 200 to not be treated as failed")
+	}
+}
+
+// TestResumeSkipperRetryFailed 確認 --retry-failed 時，之前失敗或符合
+// --retry-status 的 index 不會被跳過，會被重新排進 job 裡。
+func TestResumeSkipperRetryFailed(t *testing.T) {
+	completed := map[int]stateRecord{
+		0: {Index: 0, URL: "ok.example", Status: 200},
+		1: {Index: 1, URL: "err.example", Error: "boom"},
+		2: {Index: 2, URL: "500.example", Status: 500},
+	}
+	isFailed, err := parseRetryStatusSpec("5xx")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	skip := resumeSkipper(completed, true, isFailed)
+
+	if _, ok := skip(0); !ok {
+		t.Error("expected a successful entry to still be skipped")
+	}
+	if _, ok := skip(1); ok {
+		t.Error("expected an errored entry to be retried, not skipped")
+	}
+	if _, ok := skip(2); ok {
+		t.Error("expected a 5xx entry to be retried, not skipped")
+	}
+	if _, ok := skip(3); ok {
+		t.Error("expected an unknown index to not be skipped")
+	}
+}